@@ -13,6 +13,11 @@ import (
 
 var consumerSeq uint64
 
+func init() {
+	Register("amqp", NewAMQPBroker)
+	Register("amqps", NewAMQPBroker)
+}
+
 // AMQPBroker implements the Broker interface for AMQP.
 type AMQPBroker struct {
 	mut        sync.RWMutex
@@ -20,6 +25,12 @@ type AMQPBroker struct {
 	ch         *amqp.Channel
 	connErrors chan *amqp.Error
 	stop       chan struct{}
+	cfg        *AMQPConfig
+	confirm    *confirmState
+	reconnect  ReconnectPolicy
+
+	itersMu sync.Mutex
+	iters   map[*AMQPJobIter]struct{}
 }
 
 type connection interface {
@@ -29,56 +40,37 @@ type connection interface {
 
 // NewAMQPBroker creates a new AMQPBroker.
 func NewAMQPBroker(url string) (Broker, error) {
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %s", err)
-	}
+	return newAMQPBroker(url, nil)
+}
 
-	ch, err := conn.Channel()
+func newAMQPBroker(url string, cfg *AMQPConfig) (Broker, error) {
+	policy := reconnectPolicy(cfg)
+
+	conn, ch, err := dialWithRetry(url, cfg, policy)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open a channel: %s", err)
+		return nil, err
 	}
 
 	b := &AMQPBroker{
-		conn: conn,
-		ch:   ch,
-		stop: make(chan struct{}),
+		conn:      conn,
+		ch:        ch,
+		stop:      make(chan struct{}),
+		cfg:       cfg,
+		reconnect: policy,
+		iters:     make(map[*AMQPJobIter]struct{}),
 	}
 
-	go b.manageConnection(url)
-
-	return b, nil
-}
-
-func connect(url string) (*amqp.Connection, *amqp.Channel) {
-	// first try to connect again
-	var conn *amqp.Connection
-	var err error
-	for {
-		conn, err = amqp.Dial(url)
-		if err != nil {
-			log15.Error("error connecting to amqp", "err", err)
-			<-time.After(1 * time.Second)
-			continue
+	if cfg != nil && cfg.Confirms {
+		b.confirm = newConfirmState(cfg.PublishTimeout)
+		if err := b.setupConfirms(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to enable publisher confirms: %s", err)
 		}
-
-		break
 	}
 
-	// try to get the channel again
-	var ch *amqp.Channel
-	for {
-		ch, err = conn.Channel()
-		if err != nil {
-			log15.Error("error creatting channel", "err", err)
-			<-time.After(1 * time.Second)
-			continue
-		}
-
-		break
-	}
+	go b.manageConnection(url)
 
-	return conn, ch
+	return b, nil
 }
 
 func (b *AMQPBroker) manageConnection(url string) {
@@ -91,10 +83,26 @@ func (b *AMQPBroker) manageConnection(url string) {
 			log15.Error("amqp connection error", "err", err)
 			b.mut.Lock()
 			if err != nil {
-				b.conn, b.ch = connect(url)
-
+				conn, ch, dialErr := dialWithRetry(url, b.cfg, b.reconnect)
+				if dialErr != nil {
+					log15.Error("giving up reconnecting to amqp", "err", dialErr)
+					b.mut.Unlock()
+					return
+				}
+
+				b.conn, b.ch = conn, ch
 				b.connErrors = make(chan *amqp.Error)
 				b.conn.NotifyClose(b.connErrors)
+
+				if b.confirm != nil {
+					if err := b.setupConfirms(); err != nil {
+						log15.Error("failed to re-enable publisher confirms after reconnect", "err", err)
+					} else {
+						b.confirm.republishAll(b.ch)
+					}
+				}
+
+				b.resurrectConsumers()
 			}
 			b.mut.Unlock()
 		case <-b.stop:
@@ -103,6 +111,58 @@ func (b *AMQPBroker) manageConnection(url string) {
 	}
 }
 
+// trackIter registers iter so its channel is reopened and its Consume
+// re-issued whenever the broker reconnects.
+func (b *AMQPBroker) trackIter(iter *AMQPJobIter) {
+	b.itersMu.Lock()
+	defer b.itersMu.Unlock()
+	if b.iters == nil {
+		b.iters = make(map[*AMQPJobIter]struct{})
+	}
+	b.iters[iter] = struct{}{}
+}
+
+// forgetIter stops tracking iter, called once it is explicitly closed.
+func (b *AMQPBroker) forgetIter(iter *AMQPJobIter) {
+	b.itersMu.Lock()
+	defer b.itersMu.Unlock()
+	delete(b.iters, iter)
+}
+
+// resurrectConsumers reopens a channel for every live AMQPJobIter, re-applies
+// the prefetch=1 Qos and re-issues Consume with the same consumer tag and
+// queue, so long-running workers survive a broker restart without ever
+// observing ErrAlreadyClosed.
+func (b *AMQPBroker) resurrectConsumers() {
+	b.itersMu.Lock()
+	iters := make([]*AMQPJobIter, 0, len(b.iters))
+	for iter := range b.iters {
+		iters = append(iters, iter)
+	}
+	b.itersMu.Unlock()
+
+	for _, iter := range iters {
+		ch, err := b.conn.Channel()
+		if err != nil {
+			log15.Error("failed to reopen channel for consumer", "consumer", iter.id, "err", err)
+			continue
+		}
+
+		if err := ch.Qos(1, 0, false); err != nil {
+			log15.Error("failed to re-apply qos for consumer", "consumer", iter.id, "err", err)
+			continue
+		}
+
+		c, err := ch.Consume(iter.queueName, iter.id, false, false, false, false, nil)
+		if err != nil {
+			log15.Error("failed to resume consumer", "consumer", iter.id, "err", err)
+			continue
+		}
+
+		iter.resurrect(ch, c)
+	}
+}
+
 func (b *AMQPBroker) connection() *amqp.Connection {
 	b.mut.Lock()
 	defer b.mut.Unlock()
@@ -133,6 +193,26 @@ func (b *AMQPBroker) Queue(name string) (Queue, error) {
 	return &AMQPQueue{conn: b, queue: q}, nil
 }
 
+// DeclareTempQueue implements TempQueueDeclarer by declaring an exclusive,
+// auto-delete, non-durable queue, e.g. for an RPCClient reply queue: it is
+// torn down by the broker as soon as this connection closes or stops
+// consuming it, instead of lingering like a queue declared through Queue.
+func (b *AMQPBroker) DeclareTempQueue(name string) (Queue, error) {
+	q, err := b.ch.QueueDeclare(
+		name,  // name
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AMQPQueue{conn: b, queue: q}, nil
+}
+
 // Close closes all the connections managed by the broker.
 func (b *AMQPBroker) Close() error {
 	close(b.stop)
@@ -159,19 +239,27 @@ func (q *AMQPQueue) Publish(j *Job) error {
 		return ErrEmptyJob
 	}
 
+	msg := amqp.Publishing{
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     j.ID,
+		Priority:      uint8(j.Priority),
+		Timestamp:     j.Timestamp,
+		ContentType:   string(j.contentType),
+		ReplyTo:       j.ReplyTo,
+		CorrelationId: j.CorrelationId,
+		Body:          j.raw,
+	}
+
+	if b, ok := q.conn.(*AMQPBroker); ok && b.confirm != nil {
+		return b.confirm.publish(b.channel(), "", q.queue.Name, msg)
+	}
+
 	return q.conn.channel().Publish(
 		"",           // exchange
 		q.queue.Name, // routing key
 		false,        // mandatory
 		false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			MessageId:    j.ID,
-			Priority:     uint8(j.Priority),
-			Timestamp:    j.Timestamp,
-			ContentType:  string(j.contentType),
-			Body:         j.raw,
-		},
+		msg,
 	)
 }
 
@@ -199,19 +287,29 @@ func (q *AMQPQueue) PublishDelayed(j *Job, delay time.Duration) error {
 		return err
 	}
 
+	msg := amqp.Publishing{
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     j.ID,
+		Priority:      uint8(j.Priority),
+		Timestamp:     j.Timestamp,
+		ContentType:   string(j.contentType),
+		ReplyTo:       j.ReplyTo,
+		CorrelationId: j.CorrelationId,
+		Body:          j.raw,
+	}
+
+	// On a confirm-mode channel every publish must go through the
+	// confirmState so its delivery tag counter stays in step.
+	if b, ok := q.conn.(*AMQPBroker); ok && b.confirm != nil {
+		return b.confirm.publish(b.channel(), "", delayedQueue.Name, msg)
+	}
+
 	return q.conn.channel().Publish(
 		"",
 		delayedQueue.Name,
 		false,
 		false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			MessageId:    j.ID,
-			Priority:     uint8(j.Priority),
-			Timestamp:    j.Timestamp,
-			ContentType:  string(j.contentType),
-			Body:         j.raw,
-		},
+		msg,
 	)
 }
 
@@ -269,7 +367,13 @@ func (q *AMQPQueue) Consume() (JobIter, error) {
 		return nil, err
 	}
 
-	return &AMQPJobIter{id: id, ch: ch, c: c}, nil
+	iter := newAMQPJobIter(q.queue.Name, id, ch, c)
+	if b, ok := q.conn.(*AMQPBroker); ok {
+		iter.broker = b
+		b.trackIter(iter)
+	}
+
+	return iter, nil
 }
 
 func (q *AMQPQueue) consumeID() string {
@@ -280,30 +384,80 @@ func (q *AMQPQueue) consumeID() string {
 	)
 }
 
-// AMQP implements the JobIter interface for AMQP.
+// AMQPJobIter implements the JobIter interface for AMQP. Unlike a plain
+// amqp.Delivery channel, it survives a broker reconnect: instead of
+// surfacing ErrAlreadyClosed the moment its channel is torn down, it waits
+// for the broker to resurrect it with a freshly re-issued Consume on the
+// same consumer tag and queue.
 type AMQPJobIter struct {
-	id string
-	ch *amqp.Channel
-	c  <-chan amqp.Delivery
+	mut       sync.Mutex
+	cond      *sync.Cond
+	id        string
+	queueName string
+	ch        *amqp.Channel
+	c         <-chan amqp.Delivery
+	closed    bool
+	broker    *AMQPBroker
 }
 
-// Next returns the next job in the iter.
+func newAMQPJobIter(queueName, id string, ch *amqp.Channel, c <-chan amqp.Delivery) *AMQPJobIter {
+	i := &AMQPJobIter{id: id, queueName: queueName, ch: ch, c: c}
+	i.cond = sync.NewCond(&i.mut)
+	return i
+}
+
+// Next returns the next job in the iter, blocking across a broker reconnect
+// instead of returning an error.
 func (i *AMQPJobIter) Next() (*Job, error) {
-	d, ok := <-i.c
-	if !ok {
-		return nil, ErrAlreadyClosed
+	for {
+		i.mut.Lock()
+		if i.closed {
+			i.mut.Unlock()
+			return nil, ErrAlreadyClosed
+		}
+		c := i.c
+		i.mut.Unlock()
+
+		d, ok := <-c
+		if ok {
+			return fromDelivery(&d), nil
+		}
+
+		i.mut.Lock()
+		for !i.closed && i.c == c {
+			i.cond.Wait()
+		}
+		i.mut.Unlock()
 	}
+}
 
-	return fromDelivery(&d), nil
+// resurrect installs a freshly re-issued channel and delivery stream after a
+// broker reconnect, waking up any Next call blocked on the old one.
+func (i *AMQPJobIter) resurrect(ch *amqp.Channel, c <-chan amqp.Delivery) {
+	i.mut.Lock()
+	i.ch = ch
+	i.c = c
+	i.mut.Unlock()
+	i.cond.Broadcast()
 }
 
 // Close closes the channel of the JobIter.
 func (i *AMQPJobIter) Close() error {
-	if err := i.ch.Cancel(i.id, false); err != nil {
+	i.mut.Lock()
+	i.closed = true
+	ch := i.ch
+	i.mut.Unlock()
+	i.cond.Broadcast()
+
+	if i.broker != nil {
+		i.broker.forgetIter(i)
+	}
+
+	if err := ch.Cancel(i.id, false); err != nil {
 		return err
 	}
 
-	return i.ch.Close()
+	return ch.Close()
 }
 
 // AMQPAcknowledger implements the Acknowledger for AMQP.
@@ -312,14 +466,32 @@ type AMQPAcknowledger struct {
 	id  uint64
 }
 
-// Ack signals ackwoledgement.
+// Ack signals ackwoledgement. If the delivery's channel was torn down by a
+// reconnect before it could be acked, it returns ErrDeliveryLost so the
+// caller can decide whether to reprocess the job.
 func (a *AMQPAcknowledger) Ack() error {
-	return a.ack.Ack(a.id, false)
+	if err := a.ack.Ack(a.id, false); err != nil {
+		if err == amqp.ErrClosed {
+			return ErrDeliveryLost
+		}
+		return err
+	}
+
+	return nil
 }
 
-// Reject signals rejection.
+// Reject signals rejection. If the delivery's channel was torn down by a
+// reconnect before it could be rejected, it returns ErrDeliveryLost so the
+// caller can decide whether to reprocess the job.
 func (a *AMQPAcknowledger) Reject(requeue bool) error {
-	return a.ack.Reject(a.id, requeue)
+	if err := a.ack.Reject(a.id, requeue); err != nil {
+		if err == amqp.ErrClosed {
+			return ErrDeliveryLost
+		}
+		return err
+	}
+
+	return nil
 }
 
 func fromDelivery(d *amqp.Delivery) *Job {
@@ -328,6 +500,8 @@ func fromDelivery(d *amqp.Delivery) *Job {
 	j.Priority = Priority(d.Priority)
 	j.Timestamp = d.Timestamp
 	j.contentType = contentType(d.ContentType)
+	j.ReplyTo = d.ReplyTo
+	j.CorrelationId = d.CorrelationId
 	j.acknowledger = &AMQPAcknowledger{d.Acknowledger, d.DeliveryTag}
 	j.tag = d.DeliveryTag
 	j.raw = d.Body
@@ -0,0 +1,505 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp091 "github.com/rabbitmq/amqp091-go"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+var consumerSeq091 uint64
+
+func init() {
+	Register("amqp091", NewAMQP091Broker)
+	Register("amqps091", NewAMQP091Broker)
+}
+
+// AMQP091Broker implements the Broker interface on top of
+// rabbitmq/amqp091-go, the maintained fork of streadway/amqp, so callers
+// can opt into it without rewriting call sites that already talk to
+// AMQPBroker.
+type AMQP091Broker struct {
+	mut        sync.RWMutex
+	conn       *amqp091.Connection
+	ch         *amqp091.Channel
+	connErrors chan *amqp091.Error
+	stop       chan struct{}
+	cfg        *AMQP091Config
+	confirm    *confirmState091
+	reconnect  ReconnectPolicy
+
+	itersMu sync.Mutex
+	iters   map[*AMQP091JobIter]struct{}
+}
+
+type connection091 interface {
+	connection() *amqp091.Connection
+	channel() *amqp091.Channel
+}
+
+// NewAMQP091Broker creates a new AMQP091Broker.
+func NewAMQP091Broker(url string) (Broker, error) {
+	return newAMQP091Broker(url, nil)
+}
+
+func newAMQP091Broker(url string, cfg *AMQP091Config) (Broker, error) {
+	policy := reconnectPolicy091(cfg)
+
+	conn, ch, err := dialWithRetry091(url, cfg, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &AMQP091Broker{
+		conn:      conn,
+		ch:        ch,
+		stop:      make(chan struct{}),
+		cfg:       cfg,
+		reconnect: policy,
+		iters:     make(map[*AMQP091JobIter]struct{}),
+	}
+
+	if cfg != nil && cfg.Confirms {
+		b.confirm = newConfirmState091(cfg.PublishTimeout)
+		if err := b.setupConfirms091(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to enable publisher confirms: %s", err)
+		}
+	}
+
+	go b.manageConnection(url)
+
+	return b, nil
+}
+
+func (b *AMQP091Broker) manageConnection(url string) {
+	b.connErrors = make(chan *amqp091.Error)
+	b.conn.NotifyClose(b.connErrors)
+
+	for {
+		select {
+		case err := <-b.connErrors:
+			log15.Error("amqp091 connection error", "err", err)
+			b.mut.Lock()
+			if err != nil {
+				conn, ch, dialErr := dialWithRetry091(url, b.cfg, b.reconnect)
+				if dialErr != nil {
+					log15.Error("giving up reconnecting to amqp091", "err", dialErr)
+					b.mut.Unlock()
+					return
+				}
+
+				b.conn, b.ch = conn, ch
+				b.connErrors = make(chan *amqp091.Error)
+				b.conn.NotifyClose(b.connErrors)
+
+				if b.confirm != nil {
+					if err := b.setupConfirms091(); err != nil {
+						log15.Error("failed to re-enable publisher confirms after reconnect", "err", err)
+					} else {
+						b.confirm.republishAll(b.ch)
+					}
+				}
+
+				b.resurrectConsumers()
+			}
+			b.mut.Unlock()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// trackIter registers iter so its channel is reopened and its Consume
+// re-issued whenever the broker reconnects.
+func (b *AMQP091Broker) trackIter(iter *AMQP091JobIter) {
+	b.itersMu.Lock()
+	defer b.itersMu.Unlock()
+	if b.iters == nil {
+		b.iters = make(map[*AMQP091JobIter]struct{})
+	}
+	b.iters[iter] = struct{}{}
+}
+
+// forgetIter stops tracking iter, called once it is explicitly closed.
+func (b *AMQP091Broker) forgetIter(iter *AMQP091JobIter) {
+	b.itersMu.Lock()
+	defer b.itersMu.Unlock()
+	delete(b.iters, iter)
+}
+
+// resurrectConsumers reopens a channel for every live AMQP091JobIter,
+// re-applies the prefetch=1 Qos and re-issues Consume with the same
+// consumer tag and queue, so long-running workers survive a broker
+// restart without ever observing ErrAlreadyClosed.
+func (b *AMQP091Broker) resurrectConsumers() {
+	b.itersMu.Lock()
+	iters := make([]*AMQP091JobIter, 0, len(b.iters))
+	for iter := range b.iters {
+		iters = append(iters, iter)
+	}
+	b.itersMu.Unlock()
+
+	for _, iter := range iters {
+		ch, err := b.conn.Channel()
+		if err != nil {
+			log15.Error("failed to reopen channel for consumer", "consumer", iter.id, "err", err)
+			continue
+		}
+
+		if err := ch.Qos(1, 0, false); err != nil {
+			log15.Error("failed to re-apply qos for consumer", "consumer", iter.id, "err", err)
+			continue
+		}
+
+		c, err := ch.Consume(iter.queueName, iter.id, false, false, false, false, nil)
+		if err != nil {
+			log15.Error("failed to resume consumer", "consumer", iter.id, "err", err)
+			continue
+		}
+
+		iter.resurrect(ch, c)
+	}
+}
+
+func (b *AMQP091Broker) connection() *amqp091.Connection {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.conn
+}
+
+func (b *AMQP091Broker) channel() *amqp091.Channel {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.ch
+}
+
+// Queue returns the queue with the given name.
+func (b *AMQP091Broker) Queue(name string) (Queue, error) {
+	q, err := b.ch.QueueDeclare(
+		name,  // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &AMQP091Queue{conn: b, queue: q}, nil
+}
+
+// DeclareTempQueue implements TempQueueDeclarer by declaring an exclusive,
+// auto-delete, non-durable queue, e.g. for an RPCClient reply queue: it is
+// torn down by the broker as soon as this connection closes or stops
+// consuming it, instead of lingering like a queue declared through Queue.
+func (b *AMQP091Broker) DeclareTempQueue(name string) (Queue, error) {
+	q, err := b.ch.QueueDeclare(
+		name,  // name
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AMQP091Queue{conn: b, queue: q}, nil
+}
+
+// Close closes all the connections managed by the broker.
+func (b *AMQP091Broker) Close() error {
+	close(b.stop)
+	if err := b.channel().Close(); err != nil {
+		return err
+	}
+
+	if err := b.connection().Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AMQP091Queue implements the Queue interface for AMQP091Broker.
+type AMQP091Queue struct {
+	conn  connection091
+	queue amqp091.Queue
+}
+
+// Publish publishes the given Job to the Queue.
+func (q *AMQP091Queue) Publish(j *Job) error {
+	if j == nil || len(j.raw) == 0 {
+		return ErrEmptyJob
+	}
+
+	msg := amqp091.Publishing{
+		DeliveryMode:  amqp091.Persistent,
+		MessageId:     j.ID,
+		Priority:      uint8(j.Priority),
+		Timestamp:     j.Timestamp,
+		ContentType:   string(j.contentType),
+		ReplyTo:       j.ReplyTo,
+		CorrelationId: j.CorrelationId,
+		Body:          j.raw,
+	}
+
+	if b, ok := q.conn.(*AMQP091Broker); ok && b.confirm != nil {
+		return b.confirm.publish(b.channel(), "", q.queue.Name, msg)
+	}
+
+	return q.conn.channel().Publish(
+		"",           // exchange
+		q.queue.Name, // routing key
+		false,        // mandatory
+		false,
+		msg,
+	)
+}
+
+// PublishDelayed publishes the given Job with a given delay.
+func (q *AMQP091Queue) PublishDelayed(j *Job, delay time.Duration) error {
+	if j == nil || len(j.raw) == 0 {
+		return ErrEmptyJob
+	}
+
+	ttl := delay / time.Millisecond
+	delayedQueue, err := q.conn.channel().QueueDeclare(
+		j.ID,  // name
+		true,  // durable
+		true,  // delete when unused
+		false, // exclusive
+		false, // no-wait
+		amqp091.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": q.queue.Name,
+			"x-message-ttl":             int64(ttl),
+			"x-expires":                 int64(ttl) * 2,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return q.conn.channel().Publish(
+		"",
+		delayedQueue.Name,
+		false,
+		false,
+		amqp091.Publishing{
+			DeliveryMode:  amqp091.Persistent,
+			MessageId:     j.ID,
+			Priority:      uint8(j.Priority),
+			Timestamp:     j.Timestamp,
+			ContentType:   string(j.contentType),
+			ReplyTo:       j.ReplyTo,
+			CorrelationId: j.CorrelationId,
+			Body:          j.raw,
+		},
+	)
+}
+
+// Transaction executes the given callback inside a transaction.
+func (q *AMQP091Queue) Transaction(txcb TxCallback) error {
+	ch, err := q.conn.connection().Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %s", err)
+	}
+	defer ch.Close()
+
+	if err := ch.Tx(); err != nil {
+		return err
+	}
+
+	txQueue := &AMQP091Queue{
+		conn: &AMQP091Broker{
+			conn: q.conn.connection(),
+			ch:   ch,
+		},
+		queue: q.queue,
+	}
+
+	err = txcb(txQueue)
+	if err != nil {
+		if err := ch.TxRollback(); err != nil {
+			return err
+		}
+		return err
+	}
+
+	if err := ch.TxCommit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Consume returns a JobIter for the given queue.
+func (q *AMQP091Queue) Consume() (JobIter, error) {
+	ch, err := q.conn.connection().Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a channel: %s", err)
+	}
+
+	// enforce prefetching only one job, if this is removed the whole queue
+	// will be consumed.
+	if err := ch.Qos(1, 0, false); err != nil {
+		return nil, err
+	}
+
+	id := q.consumeID()
+	c, err := ch.Consume(q.queue.Name, id, false, false, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	iter := newAMQP091JobIter(q.queue.Name, id, ch, c)
+	if b, ok := q.conn.(*AMQP091Broker); ok {
+		iter.broker = b
+		b.trackIter(iter)
+	}
+
+	return iter, nil
+}
+
+func (q *AMQP091Queue) consumeID() string {
+	return fmt.Sprintf("%s-%s-%d",
+		os.Args[0],
+		q.queue.Name,
+		atomic.AddUint64(&consumerSeq091, 1),
+	)
+}
+
+// AMQP091JobIter implements the JobIter interface for AMQP091Broker. Unlike
+// a plain amqp091.Delivery channel, it survives a broker reconnect:
+// instead of surfacing ErrAlreadyClosed the moment its channel is torn
+// down, it waits for the broker to resurrect it with a freshly re-issued
+// Consume on the same consumer tag and queue.
+type AMQP091JobIter struct {
+	mut       sync.Mutex
+	cond      *sync.Cond
+	id        string
+	queueName string
+	ch        *amqp091.Channel
+	c         <-chan amqp091.Delivery
+	closed    bool
+	broker    *AMQP091Broker
+}
+
+func newAMQP091JobIter(queueName, id string, ch *amqp091.Channel, c <-chan amqp091.Delivery) *AMQP091JobIter {
+	i := &AMQP091JobIter{id: id, queueName: queueName, ch: ch, c: c}
+	i.cond = sync.NewCond(&i.mut)
+	return i
+}
+
+// Next returns the next job in the iter, blocking across a broker reconnect
+// instead of returning an error.
+func (i *AMQP091JobIter) Next() (*Job, error) {
+	for {
+		i.mut.Lock()
+		if i.closed {
+			i.mut.Unlock()
+			return nil, ErrAlreadyClosed
+		}
+		c := i.c
+		i.mut.Unlock()
+
+		d, ok := <-c
+		if ok {
+			return fromAMQP091Delivery(&d), nil
+		}
+
+		i.mut.Lock()
+		for !i.closed && i.c == c {
+			i.cond.Wait()
+		}
+		i.mut.Unlock()
+	}
+}
+
+// resurrect installs a freshly re-issued channel and delivery stream after a
+// broker reconnect, waking up any Next call blocked on the old one.
+func (i *AMQP091JobIter) resurrect(ch *amqp091.Channel, c <-chan amqp091.Delivery) {
+	i.mut.Lock()
+	i.ch = ch
+	i.c = c
+	i.mut.Unlock()
+	i.cond.Broadcast()
+}
+
+// Close closes the channel of the JobIter.
+func (i *AMQP091JobIter) Close() error {
+	i.mut.Lock()
+	i.closed = true
+	ch := i.ch
+	i.mut.Unlock()
+	i.cond.Broadcast()
+
+	if i.broker != nil {
+		i.broker.forgetIter(i)
+	}
+
+	if err := ch.Cancel(i.id, false); err != nil {
+		return err
+	}
+
+	return ch.Close()
+}
+
+// AMQP091Acknowledger implements the Acknowledger for AMQP091Broker.
+type AMQP091Acknowledger struct {
+	ack amqp091.Acknowledger
+	id  uint64
+}
+
+// Ack signals ackwoledgement. If the delivery's channel was torn down by a
+// reconnect before it could be acked, it returns ErrDeliveryLost so the
+// caller can decide whether to reprocess the job.
+func (a *AMQP091Acknowledger) Ack() error {
+	if err := a.ack.Ack(a.id, false); err != nil {
+		if err == amqp091.ErrClosed {
+			return ErrDeliveryLost
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Reject signals rejection. If the delivery's channel was torn down by a
+// reconnect before it could be rejected, it returns ErrDeliveryLost so the
+// caller can decide whether to reprocess the job.
+func (a *AMQP091Acknowledger) Reject(requeue bool) error {
+	if err := a.ack.Reject(a.id, requeue); err != nil {
+		if err == amqp091.ErrClosed {
+			return ErrDeliveryLost
+		}
+		return err
+	}
+
+	return nil
+}
+
+func fromAMQP091Delivery(d *amqp091.Delivery) *Job {
+	j := NewJob()
+	j.ID = d.MessageId
+	j.Priority = Priority(d.Priority)
+	j.Timestamp = d.Timestamp
+	j.contentType = contentType(d.ContentType)
+	j.ReplyTo = d.ReplyTo
+	j.CorrelationId = d.CorrelationId
+	j.acknowledger = &AMQP091Acknowledger{d.Acknowledger, d.DeliveryTag}
+	j.tag = d.DeliveryTag
+	j.raw = d.Body
+
+	return j
+}
@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	amqp091 "github.com/rabbitmq/amqp091-go"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// confirmState091 tracks in-flight publishes on a confirm-mode channel so
+// they can be resolved by NotifyPublish/NotifyReturn and, if the connection
+// is lost before that happens, republished on the next channel. Unlike
+// confirmState, it doesn't need to track delivery tags by hand:
+// amqp091.Channel.GetNextPublishSeqNo reports the tag the broker will
+// assign to the next publish directly.
+type confirmState091 struct {
+	timeout time.Duration
+
+	mut         sync.Mutex
+	outbox      []*outboxEntry091
+	byTag       map[uint64]*outboxEntry091
+	byMessageID map[string]*outboxEntry091
+}
+
+type outboxEntry091 struct {
+	tag        uint64
+	exchange   string
+	routingKey string
+	publishing amqp091.Publishing
+	result     chan error
+	resolved   sync.Once
+}
+
+func (e *outboxEntry091) resolve(err error) {
+	e.resolved.Do(func() {
+		e.result <- err
+	})
+}
+
+func newConfirmState091(timeout time.Duration) *confirmState091 {
+	if timeout <= 0 {
+		timeout = defaultPublishTimeout
+	}
+
+	return &confirmState091{
+		timeout:     timeout,
+		byTag:       make(map[uint64]*outboxEntry091),
+		byMessageID: make(map[string]*outboxEntry091),
+	}
+}
+
+// publish records msg in the outbox, publishes it on ch and blocks until the
+// broker confirms it, it is returned as undeliverable, or the timeout
+// elapses. The tag assignment and the actual Publish call are made under
+// the same lock as every other publish on this confirmState091, so the
+// order entries are keyed by byTag can never diverge from the order they
+// hit the wire - otherwise a concurrent publisher could have its ack/nack
+// resolve the wrong entry.
+func (c *confirmState091) publish(ch *amqp091.Channel, exchange, routingKey string, msg amqp091.Publishing) error {
+	c.mut.Lock()
+	entry := &outboxEntry091{
+		exchange:   exchange,
+		routingKey: routingKey,
+		publishing: msg,
+		result:     make(chan error, 1),
+	}
+	entry.tag = ch.GetNextPublishSeqNo()
+	c.outbox = append(c.outbox, entry)
+	c.byTag[entry.tag] = entry
+	c.byMessageID[msg.MessageId] = entry
+
+	err := ch.Publish(exchange, routingKey, true, false, msg)
+	c.mut.Unlock()
+
+	if err != nil {
+		c.remove(entry)
+		return err
+	}
+
+	select {
+	case err := <-entry.result:
+		return err
+	case <-time.After(c.timeout):
+		c.remove(entry)
+		return fmt.Errorf("queue: timed out waiting for publish confirmation")
+	}
+}
+
+func (c *confirmState091) remove(e *outboxEntry091) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	delete(c.byTag, e.tag)
+	delete(c.byMessageID, e.publishing.MessageId)
+	for i, o := range c.outbox {
+		if o == e {
+			c.outbox = append(c.outbox[:i], c.outbox[i+1:]...)
+			break
+		}
+	}
+}
+
+func (c *confirmState091) ack(tag uint64) {
+	c.mut.Lock()
+	entry, ok := c.byTag[tag]
+	c.mut.Unlock()
+	if !ok {
+		return
+	}
+
+	c.remove(entry)
+	entry.resolve(nil)
+}
+
+func (c *confirmState091) nack(tag uint64) {
+	c.mut.Lock()
+	entry, ok := c.byTag[tag]
+	c.mut.Unlock()
+	if !ok {
+		return
+	}
+
+	c.remove(entry)
+	entry.resolve(ErrPublishNacked)
+}
+
+func (c *confirmState091) returned(messageID string) {
+	c.mut.Lock()
+	entry, ok := c.byMessageID[messageID]
+	c.mut.Unlock()
+	if !ok {
+		return
+	}
+
+	c.remove(entry)
+	entry.resolve(ErrPublishReturned)
+}
+
+// republishAll re-publishes every outstanding outbox entry on ch, obtaining
+// fresh delivery sequence numbers for it. It holds the state lock for the
+// whole drain so concurrent Publish calls wait until it completes, mirroring
+// the broker's own reconnect serialization.
+func (c *confirmState091) republishAll(ch *amqp091.Channel) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	old := c.outbox
+	c.outbox = nil
+	c.byTag = make(map[uint64]*outboxEntry091)
+	c.byMessageID = make(map[string]*outboxEntry091)
+
+	for _, entry := range old {
+		entry.tag = ch.GetNextPublishSeqNo()
+		c.outbox = append(c.outbox, entry)
+		c.byTag[entry.tag] = entry
+		c.byMessageID[entry.publishing.MessageId] = entry
+
+		if err := ch.Publish(entry.exchange, entry.routingKey, true, false, entry.publishing); err != nil {
+			log15.Error("failed to republish queued message", "err", err)
+		}
+	}
+}
+
+// setupConfirms091 puts the broker's current channel into confirm mode and
+// starts a goroutine resolving outbox entries as NotifyPublish/NotifyReturn
+// events arrive on it. It must be called with b.mut held or, as in
+// newAMQP091Broker, before the channel is shared with anyone else.
+func (b *AMQP091Broker) setupConfirms091() error {
+	if err := b.ch.Confirm(false); err != nil {
+		return err
+	}
+
+	ch := b.ch
+	confirms := ch.NotifyPublish(make(chan amqp091.Confirmation, 64))
+	returns := ch.NotifyReturn(make(chan amqp091.Return, 64))
+
+	go b.confirm.listen(confirms, returns)
+
+	return nil
+}
+
+func (c *confirmState091) listen(confirms <-chan amqp091.Confirmation, returns <-chan amqp091.Return) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return
+			}
+			c.returned(ret.MessageId)
+		case conf, ok := <-confirms:
+			if !ok {
+				return
+			}
+			if conf.Ack {
+				c.ack(conf.DeliveryTag)
+			} else {
+				c.nack(conf.DeliveryTag)
+			}
+		}
+	}
+}
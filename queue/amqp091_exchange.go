@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"fmt"
+
+	amqp091 "github.com/rabbitmq/amqp091-go"
+)
+
+// Exchange declares an AMQP exchange, creating it if it does not exist yet.
+func (b *AMQP091Broker) Exchange(name, kind string, opts ExchangeOptions) (Exchange, error) {
+	err := b.channel().ExchangeDeclare(
+		name,
+		kind,
+		opts.Durable,
+		opts.AutoDelete,
+		opts.Internal,
+		opts.NoWait,
+		amqp091.Table(opts.Args),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AMQP091Exchange{conn: b, name: name}, nil
+}
+
+// AMQP091Exchange implements the Exchange interface for AMQP091Broker.
+type AMQP091Exchange struct {
+	conn connection091
+	name string
+}
+
+// Bind binds queue to the exchange for the given routing key.
+func (e *AMQP091Exchange) Bind(queue Queue, routingKey string, args map[string]interface{}) error {
+	q, ok := queue.(*AMQP091Queue)
+	if !ok {
+		return fmt.Errorf("queue: can't bind a %T to an AMQP091 exchange", queue)
+	}
+
+	return e.conn.channel().QueueBind(q.queue.Name, routingKey, e.name, false, amqp091.Table(args))
+}
+
+// PublishTo publishes the given Job to the named exchange with the given
+// routing key.
+func (q *AMQP091Queue) PublishTo(exchange, routingKey string, j *Job) error {
+	if j == nil || len(j.raw) == 0 {
+		return ErrEmptyJob
+	}
+
+	msg := amqp091.Publishing{
+		DeliveryMode:  amqp091.Persistent,
+		MessageId:     j.ID,
+		Priority:      uint8(j.Priority),
+		Timestamp:     j.Timestamp,
+		ContentType:   string(j.contentType),
+		ReplyTo:       j.ReplyTo,
+		CorrelationId: j.CorrelationId,
+		Body:          j.raw,
+	}
+
+	if b, ok := q.conn.(*AMQP091Broker); ok && b.confirm != nil {
+		return b.confirm.publish(b.channel(), exchange, routingKey, msg)
+	}
+
+	return q.conn.channel().Publish(exchange, routingKey, false, false, msg)
+}
+
+// ConsumeBindings returns a JobIter delivering the Jobs routed to this
+// queue through any exchange bindings declared with Exchange.Bind. Since
+// AMQP already routes those deliveries into the queue itself, this is the
+// same as Consume.
+func (q *AMQP091Queue) ConsumeBindings() (JobIter, error) {
+	return q.Consume()
+}
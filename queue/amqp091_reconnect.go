@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	amqp091 "github.com/rabbitmq/amqp091-go"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+func reconnectPolicy091(cfg *AMQP091Config) ReconnectPolicy {
+	if cfg != nil && cfg.Reconnect != nil {
+		return cfg.Reconnect.withDefaults()
+	}
+
+	return ReconnectPolicy{}.withDefaults()
+}
+
+// dialOnce091 opens a single connection and channel, without retrying.
+// The amqp091:// and amqps091:// registry schemes are mapped back to
+// amqp:// and amqps://, the only schemes amqp091-go accepts.
+func dialOnce091(url string, cfg *AMQP091Config) (*amqp091.Connection, *amqp091.Channel, error) {
+	if strings.HasPrefix(url, "amqp091://") {
+		url = "amqp://" + strings.TrimPrefix(url, "amqp091://")
+	} else if strings.HasPrefix(url, "amqps091://") {
+		url = "amqps://" + strings.TrimPrefix(url, "amqps091://")
+	}
+
+	var conn *amqp091.Connection
+	var err error
+	if cfg != nil {
+		conn, err = cfg.dial(url)
+	} else {
+		conn, err = amqp091.Dial(url)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %s", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open a channel: %s", err)
+	}
+
+	return conn, ch, nil
+}
+
+// dialWithRetry091 calls dialOnce091, retrying with exponential backoff and
+// jitter according to policy until it succeeds or MaxAttempts is reached.
+func dialWithRetry091(url string, cfg *AMQP091Config, policy ReconnectPolicy) (*amqp091.Connection, *amqp091.Channel, error) {
+	var attempt int
+	for {
+		attempt++
+
+		conn, ch, err := dialOnce091(url, cfg)
+		if err == nil {
+			return conn, ch, nil
+		}
+
+		if policy.OnReconnect != nil {
+			policy.OnReconnect(attempt, err)
+		}
+		log15.Error("error connecting to amqp091", "err", err, "attempt", attempt)
+
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return nil, nil, err
+		}
+
+		<-time.After(policy.backoff(attempt))
+	}
+}
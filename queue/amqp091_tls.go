@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	amqp091 "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQP091Config holds the connection settings for an AMQP091Broker beyond
+// the bare URL, mirroring AMQPConfig for the rabbitmq/amqp091-go backend.
+// It is reused on every reconnect performed by manageConnection, so a
+// broker configured with client-cert auth keeps authenticating the same
+// way across RabbitMQ restarts.
+type AMQP091Config struct {
+	TLS        *tls.Config
+	Heartbeat  time.Duration
+	Vhost      string
+	Locale     string
+	SASL       []amqp091.Authentication
+	ChannelMax int
+	FrameSize  int
+	Dial       func(network, addr string) (net.Conn, error)
+
+	// Confirms puts published channels into confirm mode and makes Publish
+	// block until the broker has confirmed the message, see
+	// WithPublisherConfirms091.
+	Confirms bool
+	// PublishTimeout bounds how long a confirmed Publish blocks waiting for
+	// an ack/nack. Defaults to defaultPublishTimeout when zero.
+	PublishTimeout time.Duration
+
+	// Reconnect controls the backoff used to (re)connect. A nil value uses
+	// ReconnectPolicy's defaults.
+	Reconnect *ReconnectPolicy
+}
+
+// AMQP091Option configures an AMQP091Config. It is used by
+// NewAMQP091BrokerWithOptions.
+type AMQP091Option func(*AMQP091Config)
+
+// WithTLSConfig091 sets the tls.Config used to dial amqps091:// URLs.
+func WithTLSConfig091(cfg *tls.Config) AMQP091Option {
+	return func(c *AMQP091Config) { c.TLS = cfg }
+}
+
+// WithHeartbeat091 overrides the AMQP heartbeat interval.
+func WithHeartbeat091(d time.Duration) AMQP091Option {
+	return func(c *AMQP091Config) { c.Heartbeat = d }
+}
+
+// WithVhost091 overrides the AMQP virtual host.
+func WithVhost091(vhost string) AMQP091Option {
+	return func(c *AMQP091Config) { c.Vhost = vhost }
+}
+
+// WithLocale091 overrides the AMQP locale, "en_US" if unset.
+func WithLocale091(locale string) AMQP091Option {
+	return func(c *AMQP091Config) { c.Locale = locale }
+}
+
+// WithSASL091 overrides the SASL mechanisms offered during the AMQP
+// handshake.
+func WithSASL091(auth ...amqp091.Authentication) AMQP091Option {
+	return func(c *AMQP091Config) { c.SASL = auth }
+}
+
+// WithChannelMax091 overrides the maximum number of channels allowed on the
+// connection.
+func WithChannelMax091(n int) AMQP091Option {
+	return func(c *AMQP091Config) { c.ChannelMax = n }
+}
+
+// WithFrameSize091 overrides the maximum frame size, in bytes.
+func WithFrameSize091(n int) AMQP091Option {
+	return func(c *AMQP091Config) { c.FrameSize = n }
+}
+
+// WithPublisherConfirms091 puts the broker's channels into confirm mode, so
+// Publish blocks until the broker has acked the message and returns a
+// typed error (ErrPublishNacked, ErrPublishReturned) instead of
+// best-effort TCP-level success.
+func WithPublisherConfirms091() AMQP091Option {
+	return func(c *AMQP091Config) { c.Confirms = true }
+}
+
+// WithPublishTimeout091 bounds how long a confirmed Publish blocks waiting
+// for the broker's ack/nack.
+func WithPublishTimeout091(d time.Duration) AMQP091Option {
+	return func(c *AMQP091Config) { c.PublishTimeout = d }
+}
+
+// WithReconnectPolicy091 overrides the backoff used to (re)connect.
+func WithReconnectPolicy091(policy ReconnectPolicy) AMQP091Option {
+	return func(c *AMQP091Config) { c.Reconnect = &policy }
+}
+
+// WithDial091 overrides the function used to open the underlying TCP
+// connection, e.g. to add connect timeouts or proxy through a custom
+// net.Conn.
+func WithDial091(dial func(network, addr string) (net.Conn, error)) AMQP091Option {
+	return func(c *AMQP091Config) { c.Dial = dial }
+}
+
+// NewAMQP091BrokerTLS creates a new AMQP091Broker dialed with the given
+// AMQP091Config, allowing amqps091:// connections with a custom tls.Config
+// (e.g. client-cert auth) and other amqp091.Config overrides. The same
+// config is reused by manageConnection on every reconnect.
+func NewAMQP091BrokerTLS(url string, cfg *AMQP091Config) (Broker, error) {
+	if cfg == nil {
+		cfg = &AMQP091Config{}
+	}
+
+	return newAMQP091Broker(url, cfg)
+}
+
+// NewAMQP091BrokerWithOptions creates a new AMQP091Broker configured with
+// the given options, e.g.
+// NewAMQP091BrokerWithOptions(url, WithTLSConfig091(tlsCfg)).
+func NewAMQP091BrokerWithOptions(url string, opts ...AMQP091Option) (Broker, error) {
+	cfg := &AMQP091Config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return newAMQP091Broker(url, cfg)
+}
+
+func (c *AMQP091Config) dial(url string) (*amqp091.Connection, error) {
+	ac := amqp091.Config{
+		Heartbeat:  c.Heartbeat,
+		Vhost:      c.Vhost,
+		Locale:     c.Locale,
+		SASL:       c.SASL,
+		ChannelMax: uint16(c.ChannelMax),
+		FrameSize:  c.FrameSize,
+		Dial:       c.Dial,
+	}
+
+	ac.TLSClientConfig = c.TLS
+
+	return amqp091.DialConfig(url, ac)
+}
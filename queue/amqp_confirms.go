@@ -0,0 +1,231 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// defaultPublishTimeout bounds a confirmed Publish when the broker was not
+// configured with WithPublishTimeout.
+const defaultPublishTimeout = 30 * time.Second
+
+var (
+	// ErrPublishNacked is returned by Publish, on a broker configured with
+	// WithPublisherConfirms, when the server nacks the message.
+	ErrPublishNacked = errors.New("queue: publish was nacked by the broker")
+	// ErrPublishReturned is returned by Publish, on a broker configured
+	// with WithPublisherConfirms, when the message is returned as
+	// undeliverable (e.g. no queue bound to the routing key).
+	ErrPublishReturned = errors.New("queue: publish was returned as undeliverable")
+)
+
+// confirmState tracks in-flight publishes on a confirm-mode channel so they
+// can be resolved by NotifyPublish/NotifyReturn and, if the connection is
+// lost before that happens, republished on the next channel.
+type confirmState struct {
+	timeout time.Duration
+
+	mut sync.Mutex
+	// seq tracks the delivery tag the broker will assign to the next
+	// publish on the current confirm-mode channel. streadway/amqp never
+	// backported amqp091-go's Channel.GetNextPublishSeqNo, and confirm-mode
+	// delivery tags are simply a 1-based counter reset on every Confirm
+	// call, so it is tracked by hand here instead.
+	seq         uint64
+	outbox      []*outboxEntry
+	byTag       map[uint64]*outboxEntry
+	byMessageID map[string]*outboxEntry
+}
+
+// nextSeq returns the delivery tag of the next publish on the current
+// confirm-mode channel. Callers must hold c.mut.
+func (c *confirmState) nextSeq() uint64 {
+	c.seq++
+	return c.seq
+}
+
+type outboxEntry struct {
+	tag        uint64
+	exchange   string
+	routingKey string
+	publishing amqp.Publishing
+	result     chan error
+	resolved   sync.Once
+}
+
+func (e *outboxEntry) resolve(err error) {
+	e.resolved.Do(func() {
+		e.result <- err
+	})
+}
+
+func newConfirmState(timeout time.Duration) *confirmState {
+	if timeout <= 0 {
+		timeout = defaultPublishTimeout
+	}
+
+	return &confirmState{
+		timeout:     timeout,
+		byTag:       make(map[uint64]*outboxEntry),
+		byMessageID: make(map[string]*outboxEntry),
+	}
+}
+
+// publish records msg in the outbox, publishes it on ch and blocks until the
+// broker confirms it, it is returned as undeliverable, or the timeout
+// elapses. The tag assignment and the actual Publish call are made under
+// the same lock as every other publish on this confirmState, so the order
+// entries are keyed by byTag can never diverge from the order they hit the
+// wire - otherwise a concurrent publisher could have its ack/nack resolve
+// the wrong entry.
+func (c *confirmState) publish(ch *amqp.Channel, exchange, routingKey string, msg amqp.Publishing) error {
+	c.mut.Lock()
+	entry := &outboxEntry{
+		exchange:   exchange,
+		routingKey: routingKey,
+		publishing: msg,
+		result:     make(chan error, 1),
+	}
+	entry.tag = c.nextSeq()
+	c.outbox = append(c.outbox, entry)
+	c.byTag[entry.tag] = entry
+	c.byMessageID[msg.MessageId] = entry
+
+	err := ch.Publish(exchange, routingKey, true, false, msg)
+	c.mut.Unlock()
+
+	if err != nil {
+		c.remove(entry)
+		return err
+	}
+
+	select {
+	case err := <-entry.result:
+		return err
+	case <-time.After(c.timeout):
+		c.remove(entry)
+		return fmt.Errorf("queue: timed out waiting for publish confirmation")
+	}
+}
+
+func (c *confirmState) remove(e *outboxEntry) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	delete(c.byTag, e.tag)
+	delete(c.byMessageID, e.publishing.MessageId)
+	for i, o := range c.outbox {
+		if o == e {
+			c.outbox = append(c.outbox[:i], c.outbox[i+1:]...)
+			break
+		}
+	}
+}
+
+func (c *confirmState) ack(tag uint64) {
+	c.mut.Lock()
+	entry, ok := c.byTag[tag]
+	c.mut.Unlock()
+	if !ok {
+		return
+	}
+
+	c.remove(entry)
+	entry.resolve(nil)
+}
+
+func (c *confirmState) nack(tag uint64) {
+	c.mut.Lock()
+	entry, ok := c.byTag[tag]
+	c.mut.Unlock()
+	if !ok {
+		return
+	}
+
+	c.remove(entry)
+	entry.resolve(ErrPublishNacked)
+}
+
+func (c *confirmState) returned(messageID string) {
+	c.mut.Lock()
+	entry, ok := c.byMessageID[messageID]
+	c.mut.Unlock()
+	if !ok {
+		return
+	}
+
+	c.remove(entry)
+	entry.resolve(ErrPublishReturned)
+}
+
+// republishAll re-publishes every outstanding outbox entry on ch, obtaining
+// fresh delivery sequence numbers for it. It holds the state lock for the
+// whole drain so concurrent Publish calls wait until it completes, mirroring
+// the broker's own reconnect serialization.
+func (c *confirmState) republishAll(ch *amqp.Channel) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	old := c.outbox
+	c.outbox = nil
+	c.byTag = make(map[uint64]*outboxEntry)
+	c.byMessageID = make(map[string]*outboxEntry)
+	// The channel just re-entered confirm mode via setupConfirms, so its
+	// delivery tags restart at 1.
+	c.seq = 0
+
+	for _, entry := range old {
+		entry.tag = c.nextSeq()
+		c.outbox = append(c.outbox, entry)
+		c.byTag[entry.tag] = entry
+		c.byMessageID[entry.publishing.MessageId] = entry
+
+		if err := ch.Publish(entry.exchange, entry.routingKey, true, false, entry.publishing); err != nil {
+			log15.Error("failed to republish queued message", "err", err)
+		}
+	}
+}
+
+// setupConfirms puts the broker's current channel into confirm mode and
+// starts a goroutine resolving outbox entries as NotifyPublish/NotifyReturn
+// events arrive on it. It must be called with b.mut held or, as in
+// NewAMQPBroker, before the channel is shared with anyone else.
+func (b *AMQPBroker) setupConfirms() error {
+	if err := b.ch.Confirm(false); err != nil {
+		return err
+	}
+
+	ch := b.ch
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 64))
+	returns := ch.NotifyReturn(make(chan amqp.Return, 64))
+
+	go b.confirm.listen(confirms, returns)
+
+	return nil
+}
+
+func (c *confirmState) listen(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return
+			}
+			c.returned(ret.MessageId)
+		case conf, ok := <-confirms:
+			if !ok {
+				return
+			}
+			if conf.Ack {
+				c.ack(conf.DeliveryTag)
+			} else {
+				c.nack(conf.DeliveryTag)
+			}
+		}
+	}
+}
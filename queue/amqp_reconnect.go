@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/streadway/amqp"
+	log15 "gopkg.in/inconshreveable/log15.v2"
+)
+
+// ReconnectPolicy controls how an AMQPBroker retries a dropped connection,
+// both on its initial dial and on every reconnect performed by
+// manageConnection.
+type ReconnectPolicy struct {
+	// InitialBackoff is the delay before the first retry. Defaults to 1s.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries before Jitter is applied,
+	// so a jittered delay can exceed it by up to the Jitter fraction.
+	// Defaults to 30s.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each failed attempt. Defaults to 2.
+	Multiplier float64
+	// Jitter randomizes each delay by +/- this fraction of it, e.g. 0.2
+	// for +/-20%, to avoid reconnect storms. Defaults to 0 (no jitter).
+	Jitter float64
+	// MaxAttempts bounds how many times a single connect/reconnect is
+	// retried before giving up. Zero (the default) means retry forever.
+	MaxAttempts int
+	// OnReconnect, if set, is called after every failed attempt, including
+	// the last one when MaxAttempts is reached, with the attempt number
+	// (starting at 1) and that attempt's error.
+	OnReconnect func(attempt int, err error)
+}
+
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = time.Second
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 30 * time.Second
+	}
+	if p.Multiplier <= 0 {
+		p.Multiplier = 2
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+
+	return p
+}
+
+func (p ReconnectPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if max := float64(p.MaxBackoff); d > max {
+		d = max
+	}
+
+	if p.Jitter > 0 {
+		delta := d * p.Jitter
+		d += delta * (2*rand.Float64() - 1)
+		if d < 0 {
+			d = 0
+		}
+	}
+
+	return time.Duration(d)
+}
+
+func reconnectPolicy(cfg *AMQPConfig) ReconnectPolicy {
+	if cfg != nil && cfg.Reconnect != nil {
+		return cfg.Reconnect.withDefaults()
+	}
+
+	return ReconnectPolicy{}.withDefaults()
+}
+
+// dialOnce opens a single connection and channel, without retrying.
+func dialOnce(url string, cfg *AMQPConfig) (*amqp.Connection, *amqp.Channel, error) {
+	var conn *amqp.Connection
+	var err error
+	if cfg != nil {
+		conn, err = cfg.dial(url)
+	} else {
+		conn, err = amqp.Dial(url)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %s", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open a channel: %s", err)
+	}
+
+	return conn, ch, nil
+}
+
+// dialWithRetry calls dialOnce, retrying with exponential backoff and
+// jitter according to policy until it succeeds or MaxAttempts is reached.
+func dialWithRetry(url string, cfg *AMQPConfig, policy ReconnectPolicy) (*amqp.Connection, *amqp.Channel, error) {
+	var attempt int
+	for {
+		attempt++
+
+		conn, ch, err := dialOnce(url, cfg)
+		if err == nil {
+			return conn, ch, nil
+		}
+
+		if policy.OnReconnect != nil {
+			policy.OnReconnect(attempt, err)
+		}
+		log15.Error("error connecting to amqp", "err", err, "attempt", attempt)
+
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return nil, nil, err
+		}
+
+		<-time.After(policy.backoff(attempt))
+	}
+}
@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("memory", func(url string) (Broker, error) {
+		return NewMemoryBroker(), nil
+	})
+}
+
+// MemoryBroker is an in-process Broker backed by plain slices. It is mostly
+// useful for tests, since nothing published to it survives the process.
+type MemoryBroker struct {
+	mut       sync.Mutex
+	queues    map[string]*memoryQueue
+	exchanges map[string]*memoryExchange
+}
+
+// NewMemoryBroker creates a new in-memory Broker.
+func NewMemoryBroker() Broker {
+	return &MemoryBroker{
+		queues:    make(map[string]*memoryQueue),
+		exchanges: make(map[string]*memoryExchange),
+	}
+}
+
+// Queue returns the in-memory queue with the given name, creating it the
+// first time it is requested. Repeated calls with the same name return the
+// same queue, so e.g. a reply queue declared by one caller can be published
+// to by another.
+func (b *MemoryBroker) Queue(name string) (Queue, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memoryQueue{jobs: make([]*Job, 0, 10), broker: b}
+		b.queues[name] = q
+	}
+
+	return q, nil
+}
+
+// Exchange returns the in-memory exchange with the given name and kind,
+// creating it the first time it is requested.
+func (b *MemoryBroker) Exchange(name, kind string, opts ExchangeOptions) (Exchange, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	ex, ok := b.exchanges[name]
+	if !ok {
+		ex = &memoryExchange{name: name, kind: kind}
+		b.exchanges[name] = ex
+	}
+
+	return ex, nil
+}
+
+// Close is a no-op for the memory broker.
+func (b *MemoryBroker) Close() error {
+	return nil
+}
+
+type memoryQueue struct {
+	jobs []*Job
+	sync.RWMutex
+	idx                int
+	publishImmediately bool
+	broker             *MemoryBroker
+}
+
+func (q *memoryQueue) Publish(j *Job) error {
+	if j == nil || len(j.raw) == 0 {
+		return ErrEmptyJob
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	q.jobs = append(q.jobs, j)
+	return nil
+}
+
+func (q *memoryQueue) PublishDelayed(j *Job, delay time.Duration) error {
+	if q.publishImmediately {
+		return q.Publish(j)
+	}
+
+	go func() {
+		<-time.After(delay)
+		q.Publish(j)
+	}()
+	return nil
+}
+
+func (q *memoryQueue) Transaction(txcb TxCallback) error {
+	txQ := &memoryQueue{jobs: make([]*Job, 0, 10), publishImmediately: true, broker: q.broker}
+	if err := txcb(txQ); err != nil {
+		return err
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	q.jobs = append(q.jobs, txQ.jobs...)
+	return nil
+}
+
+func (q *memoryQueue) PublishTo(exchange, routingKey string, j *Job) error {
+	if j == nil || len(j.raw) == 0 {
+		return ErrEmptyJob
+	}
+
+	if q.broker == nil {
+		return fmt.Errorf("queue: queue not attached to a broker")
+	}
+
+	q.broker.mut.Lock()
+	ex, ok := q.broker.exchanges[exchange]
+	q.broker.mut.Unlock()
+	if !ok {
+		return fmt.Errorf("queue: unknown exchange %q", exchange)
+	}
+
+	return ex.route(routingKey, j)
+}
+
+func (q *memoryQueue) Consume() (JobIter, error) {
+	return &memoryJobIter{&q.jobs, &q.idx, &q.RWMutex}, nil
+}
+
+// ConsumeBindings returns a JobIter delivering the Jobs routed to this
+// queue through any exchange bindings declared with Exchange.Bind; route
+// already appends matching Jobs to this queue's own slice, so this is the
+// same as Consume.
+func (q *memoryQueue) ConsumeBindings() (JobIter, error) {
+	return q.Consume()
+}
+
+type memoryJobIter struct {
+	jobs *[]*Job
+	idx  *int
+	*sync.RWMutex
+}
+
+type memoryAcknowledger struct{}
+
+func (*memoryAcknowledger) Ack() error { return nil }
+
+func (*memoryAcknowledger) Reject(requeue bool) error { return nil }
+
+func (i *memoryJobIter) Next() (*Job, error) {
+	i.Lock()
+	defer i.Unlock()
+	if len(*i.jobs) <= *i.idx {
+		return nil, nil
+	}
+
+	j := (*i.jobs)[*i.idx]
+	(*i.idx)++
+	j.tag = 1
+	j.acknowledger = &memoryAcknowledger{}
+	return j, nil
+}
+
+func (i *memoryJobIter) Close() error {
+	return nil
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// memoryExchange routes Jobs published through PublishTo to the queues
+// bound to it, emulating real AMQP exchange kinds closely enough for
+// tests: "fanout" delivers to every binding regardless of routing key,
+// "direct" requires an exact routing-key match, "topic" matches the
+// routing key against the binding pattern with "*"/"#" wildcards, and
+// "headers" ignores the routing key and matches the binding's args table
+// against the Job's Headers instead.
+type memoryExchange struct {
+	name string
+	kind string
+
+	mut      sync.RWMutex
+	bindings []memoryBinding
+}
+
+type memoryBinding struct {
+	queue      *memoryQueue
+	routingKey string
+	args       map[string]interface{}
+}
+
+// Bind binds queue to the exchange for the given routing key pattern (for
+// "direct"/"topic" exchanges) or args table (for "headers" exchanges).
+func (e *memoryExchange) Bind(queue Queue, routingKey string, args map[string]interface{}) error {
+	q, ok := queue.(*memoryQueue)
+	if !ok {
+		return fmt.Errorf("queue: can't bind a %T to a memory exchange", queue)
+	}
+
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	e.bindings = append(e.bindings, memoryBinding{queue: q, routingKey: routingKey, args: args})
+	return nil
+}
+
+func (e *memoryExchange) route(routingKey string, j *Job) error {
+	e.mut.RLock()
+	defer e.mut.RUnlock()
+
+	for _, b := range e.bindings {
+		if !e.matches(b, routingKey, j) {
+			continue
+		}
+
+		if err := b.queue.Publish(j); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *memoryExchange) matches(b memoryBinding, routingKey string, j *Job) bool {
+	switch e.kind {
+	case "fanout":
+		return true
+	case "headers":
+		return matchHeaders(b.args, j.Headers)
+	case "direct":
+		return b.routingKey == routingKey
+	default: // "topic"
+		return matchTopic(b.routingKey, routingKey)
+	}
+}
+
+// matchHeaders reports whether headers satisfies the binding args table,
+// following AMQP headers-exchange semantics: an "x-match" entry of "any"
+// requires at least one other key to match, anything else (the default)
+// requires all of them to.
+func matchHeaders(args, headers map[string]interface{}) bool {
+	matchAny := args["x-match"] == "any"
+
+	var any bool
+	for k, v := range args {
+		if k == "x-match" {
+			continue
+		}
+
+		if headers[k] == v {
+			any = true
+			if matchAny {
+				return true
+			}
+		} else if !matchAny {
+			return false
+		}
+	}
+
+	return any || !matchAny
+}
+
+// matchTopic reports whether routingKey matches the dot-separated AMQP
+// topic pattern, where "*" matches exactly one word and "#" matches zero or
+// more words.
+func matchTopic(pattern, routingKey string) bool {
+	return matchTopicSegments(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchTopicSegments(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+
+	switch pattern[0] {
+	case "#":
+		if matchTopicSegments(pattern[1:], key) {
+			return true
+		}
+		if len(key) == 0 {
+			return false
+		}
+		return matchTopicSegments(pattern, key[1:])
+	case "*":
+		if len(key) == 0 {
+			return false
+		}
+		return matchTopicSegments(pattern[1:], key[1:])
+	default:
+		if len(key) == 0 || key[0] != pattern[0] {
+			return false
+		}
+		return matchTopicSegments(pattern[1:], key[1:])
+	}
+}
@@ -0,0 +1,178 @@
+package queue
+
+import "testing"
+
+func newTestJob(t *testing.T, body string) *Job {
+	t.Helper()
+	j := NewJob()
+	if err := j.Encode(body); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return j
+}
+
+func consumeAllBodies(t *testing.T, q Queue) []string {
+	t.Helper()
+	iter, err := q.ConsumeBindings()
+	if err != nil {
+		t.Fatalf("ConsumeBindings: %v", err)
+	}
+	defer iter.Close()
+
+	var got []string
+	for {
+		j, err := iter.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if j == nil {
+			break
+		}
+
+		var body string
+		if err := j.Decode(&body); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		got = append(got, body)
+	}
+	return got
+}
+
+func TestMemoryExchangeDirectRequiresExactMatch(t *testing.T) {
+	broker := NewMemoryBroker()
+	ex, err := broker.Exchange("orders", "direct", ExchangeOptions{})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	q, err := broker.Queue("orders.created")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	if err := ex.Bind(q, "created", nil); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+
+	pub, err := broker.Queue("publisher")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+
+	if err := pub.PublishTo("orders", "created", newTestJob(t, "a")); err != nil {
+		t.Fatalf("PublishTo: %v", err)
+	}
+	// A topic exchange would let "*"/"#" patterns match this, but a direct
+	// exchange requires the routing key to match exactly.
+	if err := pub.PublishTo("orders", "created.extra", newTestJob(t, "b")); err != nil {
+		t.Fatalf("PublishTo: %v", err)
+	}
+
+	got := consumeAllBodies(t, q)
+	if len(got) != 1 || got[0] != "a" {
+		t.Fatalf("got %v, want [a]", got)
+	}
+}
+
+func TestMemoryExchangeTopicWildcards(t *testing.T) {
+	broker := NewMemoryBroker()
+	ex, err := broker.Exchange("logs", "topic", ExchangeOptions{})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	q, err := broker.Queue("logs.errors")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	if err := ex.Bind(q, "*.error", nil); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+
+	pub, err := broker.Queue("publisher")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+
+	if err := pub.PublishTo("logs", "api.error", newTestJob(t, "a")); err != nil {
+		t.Fatalf("PublishTo: %v", err)
+	}
+	if err := pub.PublishTo("logs", "api.info", newTestJob(t, "b")); err != nil {
+		t.Fatalf("PublishTo: %v", err)
+	}
+
+	got := consumeAllBodies(t, q)
+	if len(got) != 1 || got[0] != "a" {
+		t.Fatalf("got %v, want [a]", got)
+	}
+}
+
+func TestMemoryExchangeHeadersMatchArgsNotRoutingKey(t *testing.T) {
+	broker := NewMemoryBroker()
+	ex, err := broker.Exchange("events", "headers", ExchangeOptions{})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	q, err := broker.Queue("events.urgent")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	if err := ex.Bind(q, "", map[string]interface{}{
+		"x-match":  "all",
+		"priority": "urgent",
+	}); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+
+	pub, err := broker.Queue("publisher")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+
+	match := newTestJob(t, "a")
+	match.Headers = map[string]interface{}{"priority": "urgent"}
+	// The routing key is irrelevant for a headers exchange.
+	if err := pub.PublishTo("events", "ignored", match); err != nil {
+		t.Fatalf("PublishTo: %v", err)
+	}
+
+	mismatch := newTestJob(t, "b")
+	mismatch.Headers = map[string]interface{}{"priority": "low"}
+	if err := pub.PublishTo("events", "ignored", mismatch); err != nil {
+		t.Fatalf("PublishTo: %v", err)
+	}
+
+	got := consumeAllBodies(t, q)
+	if len(got) != 1 || got[0] != "a" {
+		t.Fatalf("got %v, want [a]", got)
+	}
+}
+
+func TestMemoryExchangeFanoutIgnoresRoutingKey(t *testing.T) {
+	broker := NewMemoryBroker()
+	ex, err := broker.Exchange("broadcast", "fanout", ExchangeOptions{})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	q, err := broker.Queue("broadcast.listener")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	if err := ex.Bind(q, "anything", nil); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+
+	pub, err := broker.Queue("publisher")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	if err := pub.PublishTo("broadcast", "whatever", newTestJob(t, "a")); err != nil {
+		t.Fatalf("PublishTo: %v", err)
+	}
+
+	got := consumeAllBodies(t, q)
+	if len(got) != 1 || got[0] != "a" {
+		t.Fatalf("got %v, want [a]", got)
+	}
+}
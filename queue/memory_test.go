@@ -0,0 +1,86 @@
+package queue
+
+import "testing"
+
+func TestMemoryQueuePublishConsume(t *testing.T) {
+	broker := NewMemoryBroker()
+	q, err := broker.Queue("jobs")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+
+	j := NewJob()
+	if err := j.Encode("hello"); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := q.Publish(j); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	iter, err := q.Consume()
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	defer iter.Close()
+
+	got, err := iter.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if got == nil {
+		t.Fatal("Next() = nil, want a Job")
+	}
+
+	var body string
+	if err := got.Decode(&body); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if body != "hello" {
+		t.Fatalf("body = %q, want %q", body, "hello")
+	}
+	if err := got.Ack(); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+
+	empty, err := iter.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if empty != nil {
+		t.Fatalf("Next() = %v, want nil once drained", empty)
+	}
+}
+
+func TestMemoryQueueIsSharedByName(t *testing.T) {
+	broker := NewMemoryBroker()
+	a, err := broker.Queue("shared")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	b, err := broker.Queue("shared")
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+
+	j := NewJob()
+	if err := j.Encode("x"); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := a.Publish(j); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	iter, err := b.Consume()
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	defer iter.Close()
+
+	got, err := iter.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if got == nil {
+		t.Fatal("Next() = nil, want the Job published through the other handle")
+	}
+}
@@ -0,0 +1,246 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func init() {
+	Register("nats", NewNATSBroker)
+}
+
+// natsDelayHeader carries the requested delay on messages published through
+// PublishDelayed. JetStream has no native per-message delay, so it is
+// enforced by a scheduler goroutine on the publishing side instead.
+const natsDelayHeader = "Nats-Msg-Delay"
+
+// natsPriorityHeader and natsTimestampHeader carry Job.Priority and
+// Job.Timestamp across the wire, since JetStream has no equivalent of
+// AMQP's per-message priority/timestamp fields.
+const (
+	natsPriorityHeader  = "Nats-Job-Priority"
+	natsTimestampHeader = "Nats-Job-Timestamp"
+)
+
+// NATSBroker implements the Broker interface on top of NATS JetStream.
+type NATSBroker struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+// NewNATSBroker creates a new Broker backed by a NATS JetStream connection.
+func NewNATSBroker(url string) (Broker, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %s", err)
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to get JetStream context: %s", err)
+	}
+
+	return &NATSBroker{conn: conn, js: js}, nil
+}
+
+// Queue returns the queue with the given name, creating its backing stream
+// if it does not exist yet.
+func (b *NATSBroker) Queue(name string) (Queue, error) {
+	if _, err := b.js.StreamInfo(name); err != nil {
+		if _, err := b.js.AddStream(&nats.StreamConfig{
+			Name:     name,
+			Subjects: []string{name},
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create stream %q: %s", name, err)
+		}
+	}
+
+	return &NATSQueue{js: b.js, subject: name}, nil
+}
+
+// Close closes the underlying NATS connection without draining it.
+func (b *NATSBroker) Close() error {
+	b.conn.Close()
+	return nil
+}
+
+// NATSQueue implements the Queue interface on top of a JetStream stream.
+type NATSQueue struct {
+	js      nats.JetStreamContext
+	subject string
+
+	// bindings holds the subjects registered via Exchange.Bind, consumed
+	// together by ConsumeBindings.
+	bindings []string
+}
+
+// Publish publishes the given Job to the queue.
+func (q *NATSQueue) Publish(j *Job) error {
+	if j == nil || len(j.raw) == 0 {
+		return ErrEmptyJob
+	}
+
+	msg := nats.NewMsg(q.subject)
+	msg.Header.Set(nats.MsgIdHdr, j.ID)
+	setJobHeaders(msg, j)
+	msg.Data = j.raw
+
+	_, err := q.js.PublishMsg(msg)
+	return err
+}
+
+// PublishDelayed publishes the given Job carrying a delay header; a
+// scheduler goroutine holds it until the delay elapses before it becomes
+// visible to consumers.
+func (q *NATSQueue) PublishDelayed(j *Job, delay time.Duration) error {
+	if j == nil || len(j.raw) == 0 {
+		return ErrEmptyJob
+	}
+
+	go func() {
+		<-time.After(delay)
+		msg := nats.NewMsg(q.subject)
+		msg.Header.Set(nats.MsgIdHdr, j.ID)
+		msg.Header.Set(natsDelayHeader, delay.String())
+		setJobHeaders(msg, j)
+		msg.Data = j.raw
+		q.js.PublishMsg(msg)
+	}()
+
+	return nil
+}
+
+// Transaction is not natively supported by JetStream; the callback runs
+// against the same queue and any Jobs it publishes take effect immediately.
+func (q *NATSQueue) Transaction(txcb TxCallback) error {
+	return txcb(q)
+}
+
+// Consume returns a JobIter backed by a durable JetStream pull consumer.
+// MaxAckPending is set to 1 to mirror the AMQP backend's prefetch=1.
+func (q *NATSQueue) Consume() (JobIter, error) {
+	sub, err := q.js.PullSubscribe(
+		q.subject,
+		durableName(q.subject),
+		nats.ManualAck(),
+		nats.AckWait(30*time.Second),
+		nats.MaxAckPending(1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe: %s", err)
+	}
+
+	return &NATSJobIter{sub: sub}, nil
+}
+
+// durableName derives a stable JetStream durable consumer name from name,
+// so a worker restart resumes its pull consumer from where it left off
+// instead of JetStream dropping an ephemeral one after InactiveThreshold.
+func durableName(name string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(name) + "-consumer"
+}
+
+// NATSJobIter implements the JobIter interface for NATS JetStream.
+type NATSJobIter struct {
+	sub    *nats.Subscription
+	closed bool
+}
+
+// Next blocks until the next job is available or the iterator is closed.
+func (i *NATSJobIter) Next() (*Job, error) {
+	for {
+		j, err := i.fetch(time.Hour)
+		if err != nil || j != nil {
+			return j, err
+		}
+	}
+}
+
+// fetch pulls a single message with the given wait, returning (nil, nil) on
+// a timeout so callers polling several subscriptions (e.g. natsFanInIter)
+// can move on to the next one instead of blocking.
+func (i *NATSJobIter) fetch(wait time.Duration) (*Job, error) {
+	if i.closed {
+		return nil, ErrAlreadyClosed
+	}
+
+	msgs, err := i.sub.Fetch(1, nats.MaxWait(wait))
+	if err != nil {
+		if i.closed {
+			return nil, ErrAlreadyClosed
+		}
+		if err == nats.ErrTimeout {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	return fromNATSMsg(msgs[0]), nil
+}
+
+// Close unsubscribes the underlying pull consumer.
+func (i *NATSJobIter) Close() error {
+	i.closed = true
+	return i.sub.Unsubscribe()
+}
+
+// NATSAcknowledger implements the Acknowledger interface for NATS JetStream
+// messages.
+type NATSAcknowledger struct {
+	msg *nats.Msg
+}
+
+// Ack acknowledges the message.
+func (a *NATSAcknowledger) Ack() error {
+	return a.msg.Ack()
+}
+
+// Reject signals rejection of the message. When requeue is true the message
+// is NAK'd for immediate redelivery; otherwise it is terminated so
+// JetStream never redelivers it.
+func (a *NATSAcknowledger) Reject(requeue bool) error {
+	if requeue {
+		return a.msg.Nak()
+	}
+
+	return a.msg.Term()
+}
+
+// setJobHeaders carries j.Priority and j.Timestamp onto msg so they survive
+// the round trip through JetStream.
+func setJobHeaders(msg *nats.Msg, j *Job) {
+	msg.Header.Set(natsPriorityHeader, strconv.Itoa(int(j.Priority)))
+	msg.Header.Set(natsTimestampHeader, j.Timestamp.Format(time.RFC3339Nano))
+}
+
+func fromNATSMsg(m *nats.Msg) *Job {
+	j := NewJob()
+	if id := m.Header.Get(nats.MsgIdHdr); id != "" {
+		j.ID = id
+	}
+
+	if p := m.Header.Get(natsPriorityHeader); p != "" {
+		if n, err := strconv.Atoi(p); err == nil {
+			j.Priority = Priority(n)
+		}
+	}
+
+	if ts := m.Header.Get(natsTimestampHeader); ts != "" {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			j.Timestamp = t
+		}
+	}
+
+	j.acknowledger = &NATSAcknowledger{msg: m}
+	j.raw = m.Data
+	return j
+}
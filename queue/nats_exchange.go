@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Exchange maps onto a JetStream stream whose subjects are namespaced under
+// name, e.g. binding routing key "logs.*.error" to an exchange "events"
+// subscribes to subject "events.logs.*.error". kind is accepted for
+// interface parity with the AMQP backends but does not change behaviour:
+// NATS subjects are inherently topic-routed.
+func (b *NATSBroker) Exchange(name, kind string, opts ExchangeOptions) (Exchange, error) {
+	if _, err := b.js.StreamInfo(name); err != nil {
+		if _, err := b.js.AddStream(&nats.StreamConfig{
+			Name:     name,
+			Subjects: []string{name + ".>"},
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create stream %q: %s", name, err)
+		}
+	}
+
+	return &NATSExchange{js: b.js, name: name}, nil
+}
+
+// NATSExchange implements the Exchange interface on top of a JetStream
+// stream namespaced by subject prefix.
+type NATSExchange struct {
+	js   nats.JetStreamContext
+	name string
+}
+
+// Bind subscribes queue to the subject "<exchange>.<routingKey>", where
+// routingKey may use NATS' own "*"/">" wildcards.
+func (e *NATSExchange) Bind(queue Queue, routingKey string, args map[string]interface{}) error {
+	q, ok := queue.(*NATSQueue)
+	if !ok {
+		return fmt.Errorf("queue: can't bind a %T to a NATS exchange", queue)
+	}
+
+	q.bindings = append(q.bindings, e.name+"."+routingKey)
+	return nil
+}
+
+// PublishTo publishes the given Job to the subject "<exchange>.<routingKey>".
+func (q *NATSQueue) PublishTo(exchange, routingKey string, j *Job) error {
+	if j == nil || len(j.raw) == 0 {
+		return ErrEmptyJob
+	}
+
+	msg := nats.NewMsg(exchange + "." + routingKey)
+	msg.Header.Set(nats.MsgIdHdr, j.ID)
+	setJobHeaders(msg, j)
+	msg.Data = j.raw
+
+	_, err := q.js.PublishMsg(msg)
+	return err
+}
+
+// ConsumeBindings returns a JobIter delivering the Jobs published to every
+// subject this queue was bound to with Exchange.Bind.
+func (q *NATSQueue) ConsumeBindings() (JobIter, error) {
+	if len(q.bindings) == 0 {
+		return q.Consume()
+	}
+
+	iters := make([]*NATSJobIter, 0, len(q.bindings))
+	for _, subject := range q.bindings {
+		sub, err := q.js.PullSubscribe(subject, durableName(subject), nats.ManualAck())
+		if err != nil {
+			for _, it := range iters {
+				it.Close()
+			}
+			return nil, fmt.Errorf("failed to subscribe to %q: %s", subject, err)
+		}
+		iters = append(iters, &NATSJobIter{sub: sub})
+	}
+
+	return &natsFanInIter{iters: iters}, nil
+}
+
+// natsFanInPoll bounds how long natsFanInIter waits on each underlying
+// subscription before moving on to the next one.
+const natsFanInPoll = 200 * time.Millisecond
+
+// natsFanInIter merges several NATSJobIters, e.g. one per topic pattern a
+// queue is bound to, into a single JobIter.
+type natsFanInIter struct {
+	iters []*NATSJobIter
+	next  int
+}
+
+// Next round-robins the underlying subscriptions, blocking until a Job is
+// found on one of them or the iterator is closed.
+func (i *natsFanInIter) Next() (*Job, error) {
+	for {
+		for n := 0; n < len(i.iters); n++ {
+			idx := (i.next + n) % len(i.iters)
+			j, err := i.iters[idx].fetch(natsFanInPoll)
+			if err != nil {
+				return nil, err
+			}
+			if j != nil {
+				i.next = idx + 1
+				return j, nil
+			}
+		}
+	}
+}
+
+// Close closes every underlying subscription.
+func (i *natsFanInIter) Close() error {
+	for _, it := range i.iters {
+		if err := it.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Priority represents how urgently a Job should be processed.
+type Priority uint8
+
+// Priority levels understood by the built-in brokers.
+const (
+	PriorityNormal Priority = iota
+	PriorityUrgent
+	PriorityHigh
+	PriorityLow
+)
+
+type contentType string
+
+const contentTypeJSON contentType = "application/json"
+
+var (
+	// ErrEmptyJob is returned when trying to publish a Job with no body.
+	ErrEmptyJob = errors.New("queue: job is empty")
+	// ErrAlreadyClosed is returned by JobIter.Next when the iterator has
+	// already been closed.
+	ErrAlreadyClosed = errors.New("queue: iterator already closed")
+	// ErrDeliveryLost is returned by Job.Ack/Job.Reject when the connection
+	// carrying the delivery was torn down and reconnected before the
+	// ack/reject could be sent, e.g. by AMQPBroker's reconnect handling. The
+	// job may already have been redelivered and should be treated as such.
+	ErrDeliveryLost = errors.New("queue: delivery lost on reconnect")
+)
+
+// Job is a unit of work published to and consumed from a Queue.
+type Job struct {
+	ID        string
+	Priority  Priority
+	Timestamp time.Time
+
+	// ReplyTo, if set, names the queue the handler processing this Job
+	// should publish its response to. CorrelationId ties that response back
+	// to the request it answers. Both are used by RPCClient/RPCServer to
+	// layer request/reply semantics on top of a plain Queue.
+	ReplyTo       string
+	CorrelationId string
+
+	// Headers carries arbitrary metadata alongside the Job body. It is
+	// matched against a binding's args by a "headers" kind Exchange instead
+	// of a routing key, mirroring AMQP headers exchanges.
+	Headers map[string]interface{}
+
+	contentType  contentType
+	raw          []byte
+	tag          uint64
+	acknowledger Acknowledger
+}
+
+// NewJob creates a new Job with a generated ID and the current timestamp.
+func NewJob() *Job {
+	return &Job{
+		ID:          uuid.New().String(),
+		Timestamp:   time.Now(),
+		contentType: contentTypeJSON,
+	}
+}
+
+// Encode serializes v as the Job body.
+func (j *Job) Encode(v interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+
+	j.contentType = contentTypeJSON
+	j.raw = buf.Bytes()
+	return nil
+}
+
+// Decode deserializes the Job body into v.
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.raw, v)
+}
+
+// Ack acknowledges the Job, telling the broker it was processed
+// successfully.
+func (j *Job) Ack() error {
+	if j.acknowledger == nil {
+		return nil
+	}
+
+	return j.acknowledger.Ack()
+}
+
+// Reject tells the broker the Job could not be processed. When requeue is
+// true the broker should make the Job available for delivery again.
+func (j *Job) Reject(requeue bool) error {
+	if j.acknowledger == nil {
+		return nil
+	}
+
+	return j.acknowledger.Reject(requeue)
+}
+
+// Acknowledger is implemented by the types that know how to ack or reject a
+// Job against the broker it came from.
+type Acknowledger interface {
+	// Ack acknowledges a Job.
+	Ack() error
+	// Reject signals a Job was not processed, optionally requeueing it.
+	Reject(requeue bool) error
+}
+
+// TxCallback is executed inside Queue.Transaction. Jobs published to the
+// Queue passed to it only become visible if the callback returns nil.
+type TxCallback func(Queue) error
+
+// Broker connects to a message broker and vends Queues.
+type Broker interface {
+	// Queue returns the queue with the given name, creating it if needed.
+	Queue(name string) (Queue, error)
+	// Exchange declares an exchange of the given name and kind ("direct",
+	// "topic", "fanout" or "headers") and returns it so queues can be
+	// bound to it.
+	Exchange(name, kind string, opts ExchangeOptions) (Exchange, error)
+	// Close closes the connection to the broker.
+	Close() error
+}
+
+// TempQueueDeclarer is implemented by Brokers that support declaring a
+// private, self-cleaning queue - exclusive to the declaring connection and
+// auto-deleted once it has no consumers - instead of the durable, shared
+// queue Broker.Queue always declares. RPCClient uses it for its reply
+// queue so restarting a client doesn't leak one durable queue per
+// instance. Brokers that don't implement it (e.g. MemoryBroker,
+// NATSBroker) fall back to Queue.
+type TempQueueDeclarer interface {
+	// DeclareTempQueue declares an exclusive, auto-delete queue with the
+	// given name.
+	DeclareTempQueue(name string) (Queue, error)
+}
+
+// Queue can publish Jobs and create iterators to consume them.
+type Queue interface {
+	// Publish publishes the given Job to the queue.
+	Publish(j *Job) error
+	// PublishDelayed publishes the given Job after the given delay.
+	PublishDelayed(j *Job, delay time.Duration) error
+	// PublishTo publishes the given Job to the named exchange with the
+	// given routing key, instead of directly to this queue.
+	PublishTo(exchange, routingKey string, j *Job) error
+	// Transaction executes the given callback, making any Jobs it publishes
+	// visible only if it returns nil.
+	Transaction(txcb TxCallback) error
+	// Consume returns a JobIter to consume jobs from the queue.
+	Consume() (JobIter, error)
+	// ConsumeBindings returns a JobIter delivering every Job routed to this
+	// queue through the exchange bindings set up with Exchange.Bind,
+	// allowing a single queue to subscribe to several topic patterns.
+	ConsumeBindings() (JobIter, error)
+}
+
+// ExchangeOptions configures how an Exchange is declared.
+type ExchangeOptions struct {
+	Durable    bool
+	AutoDelete bool
+	Internal   bool
+	NoWait     bool
+	Args       map[string]interface{}
+}
+
+// Exchange routes Jobs published to it to the queues bound to it.
+type Exchange interface {
+	// Bind makes queue receive the Jobs published to the exchange whose
+	// routing key matches routingKey. For topic exchanges, routingKey may
+	// contain "*" (exactly one word) and "#" (zero or more words) wildcards
+	// on a dot-separated key, mirroring AMQP topic routing.
+	Bind(queue Queue, routingKey string, args map[string]interface{}) error
+}
+
+// JobIter iterates over the Jobs published to a Queue.
+type JobIter interface {
+	// Next returns the next Job, blocking until one is available or the
+	// iterator is closed. The memory backend's JobIter does not block: it
+	// returns (nil, nil) when the queue is empty.
+	Next() (*Job, error)
+	// Close stops the iterator.
+	Close() error
+}
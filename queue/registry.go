@@ -0,0 +1,58 @@
+package queue
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// BrokerFactory builds a Broker from a broker URL.
+type BrokerFactory func(url string) (Broker, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]BrokerFactory)
+)
+
+// Register associates a BrokerFactory with a URL scheme, so NewBroker can
+// dispatch to it. Registering a scheme that is already taken replaces the
+// previous factory; this is mainly useful for tests that want to stub out a
+// backend.
+func Register(scheme string, factory BrokerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[scheme] = factory
+}
+
+// NewBroker creates a Broker from the given URL, dispatching to the factory
+// registered for its scheme (e.g. "amqp://", "amqps://", "nats://",
+// "memory://").
+func NewBroker(uri string) (Broker, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("queue: invalid broker url: %s", err)
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[u.Scheme]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("queue: no broker registered for scheme %q", u.Scheme)
+	}
+
+	return factory(uri)
+}
+
+// Schemes returns the sorted list of currently registered broker schemes.
+func Schemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	schemes := make([]string, 0, len(registry))
+	for scheme := range registry {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
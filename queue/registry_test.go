@@ -0,0 +1,32 @@
+package queue
+
+import "testing"
+
+func TestNewBrokerDispatchesByScheme(t *testing.T) {
+	broker, err := NewBroker("memory://")
+	if err != nil {
+		t.Fatalf("NewBroker: %v", err)
+	}
+	if _, ok := broker.(*MemoryBroker); !ok {
+		t.Fatalf("got %T, want *MemoryBroker", broker)
+	}
+}
+
+func TestNewBrokerUnknownScheme(t *testing.T) {
+	if _, err := NewBroker("doesnotexist://"); err == nil {
+		t.Fatal("expected an error for an unregistered scheme")
+	}
+}
+
+func TestSchemesIncludesMemory(t *testing.T) {
+	var found bool
+	for _, s := range Schemes() {
+		if s == "memory" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatalf("Schemes() = %v, want it to include %q", Schemes(), "memory")
+	}
+}
@@ -0,0 +1,218 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rpcPollInterval is how often RPCClient and RPCServer retry Next() against
+// backends such as the memory broker whose JobIter.Next returns (nil, nil)
+// instead of blocking when the queue is empty.
+const rpcPollInterval = 10 * time.Millisecond
+
+// RPCClient layers request/reply semantics on top of a Broker: Call
+// publishes a Job to a queue and waits for a response carrying the same
+// CorrelationId on a reply queue private to the client.
+type RPCClient struct {
+	broker   Broker
+	replyTo  string
+	iter     JobIter
+	mut      sync.Mutex
+	inflight map[string]chan *Job
+	stop     chan struct{}
+}
+
+// NewRPCClient creates an RPCClient that declares its own reply queue on
+// broker and starts demultiplexing responses into Call's callers.
+func NewRPCClient(broker Broker) (*RPCClient, error) {
+	replyTo := "rpc.reply." + uuid.New().String()
+
+	var q Queue
+	var err error
+	if d, ok := broker.(TempQueueDeclarer); ok {
+		q, err = d.DeclareTempQueue(replyTo)
+	} else {
+		q, err = broker.Queue(replyTo)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare reply queue: %s", err)
+	}
+
+	iter, err := q.Consume()
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume reply queue: %s", err)
+	}
+
+	c := &RPCClient{
+		broker:   broker,
+		replyTo:  replyTo,
+		iter:     iter,
+		inflight: make(map[string]chan *Job),
+		stop:     make(chan struct{}),
+	}
+
+	go c.demux()
+
+	return c, nil
+}
+
+func (c *RPCClient) demux() {
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+
+		j, err := c.iter.Next()
+		if err != nil {
+			return
+		}
+
+		if j == nil {
+			time.Sleep(rpcPollInterval)
+			continue
+		}
+
+		c.mut.Lock()
+		ch, ok := c.inflight[j.CorrelationId]
+		if ok {
+			delete(c.inflight, j.CorrelationId)
+		}
+		c.mut.Unlock()
+
+		if ok {
+			ch <- j
+		}
+
+		// Ack regardless of whether a caller was still waiting: the
+		// reply queue is consumed with prefetch=1/manual-ack, so leaving
+		// this delivery unacked would stall every subsequent reply.
+		j.Ack()
+	}
+}
+
+// Call publishes req to the named queue and blocks until a matching
+// response arrives, ctx is done, or an error occurs. req.ReplyTo and
+// req.CorrelationId are overwritten.
+func (c *RPCClient) Call(ctx context.Context, queueName string, req *Job) (*Job, error) {
+	q, err := c.broker.Queue(queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	req.ReplyTo = c.replyTo
+	req.CorrelationId = uuid.New().String()
+
+	ch := make(chan *Job, 1)
+	c.mut.Lock()
+	c.inflight[req.CorrelationId] = ch
+	c.mut.Unlock()
+	defer func() {
+		c.mut.Lock()
+		delete(c.inflight, req.CorrelationId)
+		c.mut.Unlock()
+	}()
+
+	if err := q.Publish(req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the reply demultiplexer and closes the reply queue iterator.
+func (c *RPCClient) Close() error {
+	close(c.stop)
+	return c.iter.Close()
+}
+
+// RPCHandler processes an incoming request Job and returns the Job to send
+// back as a response.
+type RPCHandler func(context.Context, *Job) (*Job, error)
+
+// RPCServer consumes a queue and answers every Job that carries a ReplyTo
+// with the result of an RPCHandler, publishing the response to that queue
+// with the same CorrelationId.
+type RPCServer struct {
+	broker  Broker
+	queue   Queue
+	handler RPCHandler
+}
+
+// NewRPCServer creates an RPCServer that consumes queueName on broker and
+// answers requests with handler.
+func NewRPCServer(broker Broker, queueName string, handler RPCHandler) (*RPCServer, error) {
+	q, err := broker.Queue(queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RPCServer{broker: broker, queue: q, handler: handler}, nil
+}
+
+// Serve consumes requests until ctx is done or the underlying queue errors.
+func (s *RPCServer) Serve(ctx context.Context) error {
+	iter, err := s.queue.Consume()
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		j, err := iter.Next()
+		if err != nil {
+			return err
+		}
+
+		if j == nil {
+			time.Sleep(rpcPollInterval)
+			continue
+		}
+
+		go s.handle(ctx, j)
+	}
+}
+
+func (s *RPCServer) handle(ctx context.Context, req *Job) {
+	if req.ReplyTo == "" {
+		req.Ack()
+		return
+	}
+
+	resp, err := s.handler(ctx, req)
+	if err != nil {
+		req.Reject(false)
+		return
+	}
+
+	resp.CorrelationId = req.CorrelationId
+
+	replyQueue, err := s.broker.Queue(req.ReplyTo)
+	if err != nil {
+		req.Reject(false)
+		return
+	}
+
+	if err := replyQueue.Publish(resp); err != nil {
+		req.Reject(false)
+		return
+	}
+
+	req.Ack()
+}
@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRPCClientCallTwice(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	server, err := NewRPCServer(broker, "rpc.echo", func(_ context.Context, req *Job) (*Job, error) {
+		var body string
+		if err := req.Decode(&body); err != nil {
+			return nil, err
+		}
+
+		resp := NewJob()
+		if err := resp.Encode(body); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	})
+	if err != nil {
+		t.Fatalf("NewRPCServer: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Serve(ctx)
+
+	client, err := NewRPCClient(broker)
+	if err != nil {
+		t.Fatalf("NewRPCClient: %v", err)
+	}
+	defer client.Close()
+
+	// Regression test: the reply queue is consumed with prefetch=1 on the
+	// AMQP backends, so a Call that leaves its reply unacked would starve
+	// every subsequent Call of a delivery. Calling twice in a row exercises
+	// that even though the memory backend's no-op Acknowledger can't.
+	for i := 0; i < 2; i++ {
+		req := NewJob()
+		if err := req.Encode("ping"); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+
+		callCtx, callCancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := client.Call(callCtx, "rpc.echo", req)
+		callCancel()
+		if err != nil {
+			t.Fatalf("Call #%d: %v", i+1, err)
+		}
+
+		var got string
+		if err := resp.Decode(&got); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if got != "ping" {
+			t.Fatalf("Call #%d: got %q, want %q", i+1, got, "ping")
+		}
+	}
+}
+
+type spyAcknowledger struct {
+	acked bool
+}
+
+func (s *spyAcknowledger) Ack() error {
+	s.acked = true
+	return nil
+}
+
+func (s *spyAcknowledger) Reject(requeue bool) error {
+	return nil
+}
+
+type onceJobIter struct {
+	job  *Job
+	done bool
+}
+
+func (i *onceJobIter) Next() (*Job, error) {
+	if i.done {
+		return nil, nil
+	}
+	i.done = true
+	return i.job, nil
+}
+
+func (i *onceJobIter) Close() error { return nil }
+
+func TestRPCClientDemuxAcksReplies(t *testing.T) {
+	reply := NewJob()
+	reply.CorrelationId = "abc"
+	spy := &spyAcknowledger{}
+	reply.acknowledger = spy
+
+	c := &RPCClient{
+		iter:     &onceJobIter{job: reply},
+		inflight: make(map[string]chan *Job),
+		stop:     make(chan struct{}),
+	}
+
+	ch := make(chan *Job, 1)
+	c.mut.Lock()
+	c.inflight["abc"] = ch
+	c.mut.Unlock()
+
+	go c.demux()
+	defer close(c.stop)
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the reply to be delivered")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !spy.acked && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !spy.acked {
+		t.Fatal("demux did not ack the reply delivery")
+	}
+}